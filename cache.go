@@ -0,0 +1,301 @@
+package main
+
+import (
+	"compress/gzip"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	CACHE_BACKEND     string        = "none"
+	CACHE_TTL         time.Duration = 15 * time.Minute
+	CACHE_MAX_ENTRIES int           = 1000
+	CACHE_DIR         string        = "crawl4ai-proxy-cache"
+)
+
+// cacheBackend is nil when caching is disabled (CACHE_BACKEND=none, the
+// default), in which case every request behaves as if no cache existed.
+var cacheBackend Cache
+
+func readCacheEnvironment() {
+	if backend := os.Getenv("CACHE_BACKEND"); backend != "" {
+		CACHE_BACKEND = backend
+	}
+
+	if ttlStr := os.Getenv("CACHE_TTL"); ttlStr != "" {
+		ttl, err := time.ParseDuration(ttlStr)
+		if err == nil && ttl > 0 {
+			CACHE_TTL = ttl
+		}
+	}
+
+	if maxEntriesStr := os.Getenv("CACHE_MAX_ENTRIES"); maxEntriesStr != "" {
+		maxEntries, err := strconv.Atoi(maxEntriesStr)
+		if err == nil && maxEntries > 0 {
+			CACHE_MAX_ENTRIES = maxEntries
+		}
+	}
+
+	if dir := os.Getenv("CACHE_DIR"); dir != "" {
+		CACHE_DIR = dir
+	}
+
+	switch CACHE_BACKEND {
+	case "memory":
+		cacheBackend = newMemoryCache(CACHE_MAX_ENTRIES)
+	case "disk":
+		disk, err := newDiskCache(CACHE_DIR)
+		if err != nil {
+			log.Printf("cache: disabling disk cache, failed to prepare %s: %v\n", CACHE_DIR, err)
+			cacheBackend = nil
+			return
+		}
+		cacheBackend = disk
+	default:
+		cacheBackend = nil
+	}
+}
+
+// Cache memoizes successful SuccessResponseItems so repeated crawls of the
+// same URL (with the same effective browser/crawler config) within a TTL
+// can skip the upstream call entirely.
+type Cache interface {
+	Get(key string) (SuccessResponseItem, bool)
+	Set(key string, item SuccessResponseItem, ttl time.Duration)
+}
+
+// cacheKey mixes the url with the canonical (key-sorted, via
+// encoding/json's map marshaling) form of the effective configs, so
+// per-request overrides don't collide with a plain crawl of the same url.
+func cacheKey(url string, browserConfig map[string]any, crawlerRunConfig map[string]any) string {
+	hash := sha256.New()
+	hash.Write([]byte(url))
+	hash.Write(jsonEncodeInfallible(browserConfig))
+	hash.Write(jsonEncodeInfallible(crawlerRunConfig))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+type cacheEntry struct {
+	key       string
+	item      SuccessResponseItem
+	expiresAt time.Time
+}
+
+// memoryCache is an in-memory LRU bounded to CACHE_MAX_ENTRIES.
+type memoryCache struct {
+	maxEntries int
+
+	mu       sync.Mutex
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func newMemoryCache(maxEntries int) *memoryCache {
+	return &memoryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		elements:   map[string]*list.Element{},
+	}
+}
+
+func (c *memoryCache) Get(key string) (SuccessResponseItem, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.elements[key]
+	if !exists {
+		return SuccessResponseItem{}, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.elements, key)
+		return SuccessResponseItem{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.item, true
+}
+
+func (c *memoryCache) Set(key string, item SuccessResponseItem, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.elements[key]; exists {
+		entry := elem.Value.(*cacheEntry)
+		entry.item = item
+		entry.expiresAt = time.Now().Add(ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	elem := c.order.PushFront(&cacheEntry{key: key, item: item, expiresAt: time.Now().Add(ttl)})
+	c.elements[key] = elem
+
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.elements, oldest.Value.(*cacheEntry).key)
+		}
+	}
+}
+
+// diskCache stores one gzip-compressed JSON file per key under dir. TTL is
+// enforced against the file's mtime rather than stored per-entry, since the
+// filesystem already tracks it for free.
+type diskCache struct {
+	dir string
+}
+
+func newDiskCache(dir string) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &diskCache{dir: dir}, nil
+}
+
+func (c *diskCache) pathFor(key string) string {
+	return filepath.Join(c.dir, key+".json.gz")
+}
+
+type diskCacheEntry struct {
+	Item SuccessResponseItem `json:"item"`
+}
+
+func (c *diskCache) Get(key string) (SuccessResponseItem, bool) {
+	path := c.pathFor(key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return SuccessResponseItem{}, false
+	}
+	if time.Since(info.ModTime()) > CACHE_TTL {
+		os.Remove(path)
+		return SuccessResponseItem{}, false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return SuccessResponseItem{}, false
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return SuccessResponseItem{}, false
+	}
+	defer gzipReader.Close()
+
+	body, err := io.ReadAll(gzipReader)
+	if err != nil {
+		return SuccessResponseItem{}, false
+	}
+
+	var stored diskCacheEntry
+	if err := json.Unmarshal(body, &stored); err != nil {
+		return SuccessResponseItem{}, false
+	}
+
+	return stored.Item, true
+}
+
+func (c *diskCache) Set(key string, item SuccessResponseItem, ttl time.Duration) {
+	tmpFile, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		log.Printf("cache: failed to create temp file in %s: %v\n", c.dir, err)
+		return
+	}
+	tmpPath := tmpFile.Name()
+
+	gzipWriter := gzip.NewWriter(tmpFile)
+	_, writeErr := gzipWriter.Write(jsonEncodeInfallible(diskCacheEntry{Item: item}))
+	closeErr := gzipWriter.Close()
+	tmpFile.Close()
+
+	if writeErr != nil || closeErr != nil {
+		os.Remove(tmpPath)
+		log.Printf("cache: failed to write entry for key %s: %v\n", key, firstNonNil(writeErr, closeErr))
+		return
+	}
+
+	if err := os.Rename(tmpPath, c.pathFor(key)); err != nil {
+		os.Remove(tmpPath)
+		log.Printf("cache: failed to rename entry into place for key %s: %v\n", key, err)
+	}
+}
+
+// lookupCachedItems checks cacheBackend for every url and reports whether
+// every one of them was a hit, so CrawlEndpoint can serve straight from
+// cache only when the whole batch is already warm.
+func lookupCachedItems(urls []string, browserConfig map[string]any, crawlerRunConfig map[string]any) ([]SuccessResponseItem, bool) {
+	items := make([]SuccessResponseItem, len(urls))
+	allHit := true
+
+	for i, url := range urls {
+		item, hit := cacheBackend.Get(cacheKey(url, browserConfig, crawlerRunConfig))
+		if !hit {
+			allHit = false
+			crawlCacheMissesTotal.Inc()
+			continue
+		}
+		items[i] = item
+		crawlCacheHitsTotal.Inc()
+	}
+
+	return items, allHit
+}
+
+// storeCachedItems populates the cache with freshly crawled items, keyed by
+// the url each was requested under, so a later lookupCachedItems call -
+// which keys off the same requested urls - can actually find them. Each
+// item is first matched against requestUrls by its own Metadata["source"];
+// that only lines up when crawl4ai echoes the url back unchanged, so as a
+// fallback for the common single-url request we pair items to requestUrls
+// positionally. We never fall back positionally for a multi-url batch,
+// since crawl4ai isn't guaranteed to preserve request order or a 1:1 count,
+// and caching a result under the wrong url's key would serve it back to a
+// future request for that other url.
+func storeCachedItems(items SuccessResponse, requestUrls []string, browserConfig map[string]any, crawlerRunConfig map[string]any) {
+	requestUrlSet := map[string]bool{}
+	for _, url := range requestUrls {
+		requestUrlSet[url] = true
+	}
+
+	singleUrlBatch := len(requestUrls) == 1 && len(items) == 1
+
+	for i, item := range items {
+		sourceUrl := item.Metadata["source"]
+
+		var url string
+		switch {
+		case sourceUrl != "" && requestUrlSet[sourceUrl]:
+			url = sourceUrl
+		case singleUrlBatch:
+			url = requestUrls[i]
+		default:
+			continue
+		}
+
+		cacheBackend.Set(cacheKey(url, browserConfig, crawlerRunConfig), item, CACHE_TTL)
+	}
+}
+
+func firstNonNil(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
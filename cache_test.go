@@ -0,0 +1,172 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKeyDiffersByConfig(t *testing.T) {
+	a := cacheKey("https://example.com", map[string]any{"text_mode": true}, map[string]any{})
+	b := cacheKey("https://example.com", map[string]any{"text_mode": false}, map[string]any{})
+
+	if a == b {
+		t.Fatalf("expected cache keys to differ when browserConfig differs")
+	}
+
+	c := cacheKey("https://example.com", map[string]any{"text_mode": true}, map[string]any{})
+	if a != c {
+		t.Fatalf("expected identical inputs to produce identical cache keys")
+	}
+}
+
+func TestMemoryCacheGetSetAndTTL(t *testing.T) {
+	cache := newMemoryCache(10)
+	item := SuccessResponseItem{PageContent: "hello", Metadata: map[string]string{"source": "https://example.com"}}
+
+	if _, hit := cache.Get("missing"); hit {
+		t.Fatalf("expected a miss for a key that was never set")
+	}
+
+	cache.Set("key", item, time.Hour)
+	got, hit := cache.Get("key")
+	if !hit || got.PageContent != "hello" {
+		t.Fatalf("expected a hit with the stored item, got hit=%v item=%#v", hit, got)
+	}
+
+	cache.Set("expired", item, -time.Second)
+	if _, hit := cache.Get("expired"); hit {
+		t.Fatalf("expected an already-expired entry to be treated as a miss")
+	}
+}
+
+func TestMemoryCacheEvictsOldestBeyondMaxEntries(t *testing.T) {
+	cache := newMemoryCache(2)
+	item := SuccessResponseItem{PageContent: "x"}
+
+	cache.Set("a", item, time.Hour)
+	cache.Set("b", item, time.Hour)
+	cache.Set("c", item, time.Hour)
+
+	if _, hit := cache.Get("a"); hit {
+		t.Fatalf("expected the oldest entry to be evicted once past CACHE_MAX_ENTRIES")
+	}
+	if _, hit := cache.Get("c"); !hit {
+		t.Fatalf("expected the most recently set entry to still be present")
+	}
+}
+
+func TestStoreCachedItemsKeyedByRequestedUrl(t *testing.T) {
+	previousBackend := cacheBackend
+	cacheBackend = newMemoryCache(10)
+	defer func() { cacheBackend = previousBackend }()
+
+	browserConfig := map[string]any{"text_mode": true}
+	crawlerRunConfig := map[string]any{}
+
+	requestUrls := []string{"https://example.com"}
+	items := SuccessResponse{
+		{PageContent: "hello", Metadata: map[string]string{"source": "https://example.com/"}},
+	}
+
+	storeCachedItems(items, requestUrls, browserConfig, crawlerRunConfig)
+
+	cachedItems, allHit := lookupCachedItems(requestUrls, browserConfig, crawlerRunConfig)
+	if !allHit {
+		t.Fatalf("expected a cache hit keyed by the requested url, even though crawl4ai returned a different url")
+	}
+	if len(cachedItems) != 1 || cachedItems[0].PageContent != "hello" {
+		t.Fatalf("expected the stored item back, got %#v", cachedItems)
+	}
+}
+
+func TestStoreCachedItemsMatchesMultiUrlBatchBySource(t *testing.T) {
+	previousBackend := cacheBackend
+	cacheBackend = newMemoryCache(10)
+	defer func() { cacheBackend = previousBackend }()
+
+	browserConfig := map[string]any{"text_mode": true}
+	crawlerRunConfig := map[string]any{}
+
+	requestUrls := []string{"https://a.example.com", "https://b.example.com"}
+	// Reversed relative to requestUrls, as if crawl4ai returned them out of order.
+	items := SuccessResponse{
+		{PageContent: "b content", Metadata: map[string]string{"source": "https://b.example.com"}},
+		{PageContent: "a content", Metadata: map[string]string{"source": "https://a.example.com"}},
+	}
+
+	storeCachedItems(items, requestUrls, browserConfig, crawlerRunConfig)
+
+	cachedItems, allHit := lookupCachedItems(requestUrls, browserConfig, crawlerRunConfig)
+	if !allHit {
+		t.Fatalf("expected both urls to hit once matched by source")
+	}
+	if cachedItems[0].PageContent != "a content" || cachedItems[1].PageContent != "b content" {
+		t.Fatalf("expected each item cached under its own source url despite out-of-order results, got %#v", cachedItems)
+	}
+}
+
+func TestStoreCachedItemsSkipsMultiUrlBatchWithoutMatchingSource(t *testing.T) {
+	previousBackend := cacheBackend
+	cacheBackend = newMemoryCache(10)
+	defer func() { cacheBackend = previousBackend }()
+
+	browserConfig := map[string]any{"text_mode": true}
+	crawlerRunConfig := map[string]any{}
+
+	requestUrls := []string{"https://a.example.com", "https://b.example.com"}
+	// Neither source matches a requested url (e.g. both redirected elsewhere),
+	// so there's no safe way to attribute these to a or b positionally.
+	items := SuccessResponse{
+		{PageContent: "first", Metadata: map[string]string{"source": "https://redirected.example.com/1"}},
+		{PageContent: "second", Metadata: map[string]string{"source": "https://redirected.example.com/2"}},
+	}
+
+	storeCachedItems(items, requestUrls, browserConfig, crawlerRunConfig)
+
+	if _, allHit := lookupCachedItems(requestUrls, browserConfig, crawlerRunConfig); allHit {
+		t.Fatalf("expected no cache entries to be written when results can't be safely attributed to a request url")
+	}
+}
+
+func TestDiskCacheGetSet(t *testing.T) {
+	previousTTL := CACHE_TTL
+	CACHE_TTL = time.Hour
+	defer func() { CACHE_TTL = previousTTL }()
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache, err := newDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := SuccessResponseItem{PageContent: "hello", Metadata: map[string]string{"source": "https://example.com"}}
+	cache.Set("key", item, CACHE_TTL)
+
+	got, hit := cache.Get("key")
+	if !hit || got.PageContent != "hello" {
+		t.Fatalf("expected a hit with the stored item, got hit=%v item=%#v", hit, got)
+	}
+
+	if _, hit := cache.Get("missing"); hit {
+		t.Fatalf("expected a miss for a key that was never set")
+	}
+}
+
+func TestDiskCacheExpiresViaMtime(t *testing.T) {
+	previousTTL := CACHE_TTL
+	CACHE_TTL = -time.Second
+	defer func() { CACHE_TTL = previousTTL }()
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache, err := newDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Set("key", SuccessResponseItem{PageContent: "hello"}, time.Hour)
+
+	if _, hit := cache.Get("key"); hit {
+		t.Fatalf("expected entry older than CACHE_TTL to be treated as a miss")
+	}
+}
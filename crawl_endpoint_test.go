@@ -247,7 +247,7 @@ func TestCrawlRequestPayloadCandidates(t *testing.T) {
 		}
 	}
 
-	singleCandidates := crawlRequestPayloadCandidates([]string{"https://example.com/single"})
+	singleCandidates := crawlRequestPayloadCandidates([]string{"https://example.com/single"}, Request{})
 	if len(singleCandidates) != 2 {
 		t.Fatalf("expected 2 payload candidates for single url, got %d", len(singleCandidates))
 	}
@@ -270,7 +270,7 @@ func TestCrawlRequestPayloadCandidates(t *testing.T) {
 	}
 	expectDefaultConfigs(singleAsUrlsMap)
 
-	multiCandidates := crawlRequestPayloadCandidates([]string{"https://example.com/a", "https://example.com/b"})
+	multiCandidates := crawlRequestPayloadCandidates([]string{"https://example.com/a", "https://example.com/b"}, Request{})
 	if len(multiCandidates) != 1 {
 		t.Fatalf("expected 1 payload candidate for multi url, got %d", len(multiCandidates))
 	}
@@ -285,3 +285,49 @@ func TestCrawlRequestPayloadCandidates(t *testing.T) {
 	}
 	expectDefaultConfigs(multiAsMap)
 }
+
+func TestCrawlRequestPayloadCandidatesUserOverrides(t *testing.T) {
+	overrides := Request{
+		BrowserConfig: map[string]any{
+			"text_mode": false,
+			"headless":  true,
+		},
+		CrawlerRunConfig: map[string]any{
+			"magic":   false,
+			"timeout": float64(10),
+		},
+		WaitFor: "css:.loaded",
+	}
+
+	candidates := crawlRequestPayloadCandidates([]string{"https://example.com/a", "https://example.com/b"}, overrides)
+	if len(candidates) != 1 {
+		t.Fatalf("expected 1 payload candidate for multi url, got %d", len(candidates))
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(candidates[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	browserConfig := payload["browserConfig"].(map[string]any)
+	if browserConfig["text_mode"] != false {
+		t.Fatalf("expected user text_mode=false to win over the default, got %#v", browserConfig["text_mode"])
+	}
+	if browserConfig["headless"] != true {
+		t.Fatalf("expected unknown browserConfig key to be preserved verbatim, got %#v", browserConfig)
+	}
+
+	runConfig := payload["crawlerRunConfig"].(map[string]any)
+	if runConfig["magic"] != false {
+		t.Fatalf("expected user magic=false to win over the default, got %#v", runConfig["magic"])
+	}
+	if runConfig["remove_overlay_elements"] != true || runConfig["exclude_all_images"] != true {
+		t.Fatalf("expected defaults to still apply for absent keys, got %#v", runConfig)
+	}
+	if runConfig["timeout"] != float64(10) {
+		t.Fatalf("expected unknown crawlerRunConfig key to be preserved verbatim, got %#v", runConfig)
+	}
+	if runConfig["wait_for"] != "css:.loaded" {
+		t.Fatalf("expected the wait_for shortcut to populate crawlerRunConfig, got %#v", runConfig)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCrawlDeadline(t *testing.T) {
+	previousDefault := CRAWL_TIMEOUT
+	CRAWL_TIMEOUT = 30 * time.Second
+	defer func() { CRAWL_TIMEOUT = previousDefault }()
+
+	request, err := http.NewRequest("POST", "/crawl", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	if got := crawlDeadline(request, Request{}); got != 30*time.Second {
+		t.Fatalf("expected default CRAWL_TIMEOUT, got %v", got)
+	}
+
+	if got := crawlDeadline(request, Request{TimeoutSeconds: 5}); got != 5*time.Second {
+		t.Fatalf("expected timeout_seconds to win over default, got %v", got)
+	}
+
+	request.Header.Set("X-Crawl-Timeout", "2")
+	if got := crawlDeadline(request, Request{TimeoutSeconds: 5}); got != 2*time.Second {
+		t.Fatalf("expected X-Crawl-Timeout header to win over timeout_seconds, got %v", got)
+	}
+}
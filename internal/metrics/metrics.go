@@ -0,0 +1,259 @@
+// Package metrics is a small, dependency-free Prometheus exposition
+// surface. It is not a general client library: it covers exactly the
+// counter/histogram/gauge shapes crawl4ai-proxy needs so CrawlEndpoint,
+// callCrawlAPI, and callCrawlAPIWithFallback can record observations
+// without owning (or importing) a full metrics registry.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value += delta
+}
+
+func (c *Counter) snapshot() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// CounterVec is a counter partitioned by a single label.
+type CounterVec struct {
+	labelName string
+
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+func NewCounterVec(labelName string) *CounterVec {
+	return &CounterVec{labelName: labelName, counts: map[string]float64{}}
+}
+
+func (c *CounterVec) Inc(labelValue string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[labelValue]++
+}
+
+func (c *CounterVec) snapshot() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make(map[string]float64, len(c.counts))
+	for k, v := range c.counts {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Gauge is a value that can go up or down.
+type Gauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+}
+
+func (g *Gauge) snapshot() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+// Histogram tracks a cumulative Prometheus-style bucketed distribution.
+type Histogram struct {
+	upperBounds []float64
+
+	mu           sync.Mutex
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+func NewHistogram(upperBounds []float64) *Histogram {
+	bounds := append([]float64{}, upperBounds...)
+	sort.Float64s(bounds)
+	return &Histogram{
+		upperBounds:  bounds,
+		bucketCounts: make([]uint64, len(bounds)),
+	}
+}
+
+// DefaultDurationBuckets suits second-scale latencies such as upstream
+// crawl calls.
+var DefaultDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// DefaultByteBuckets suits response body sizes.
+var DefaultByteBuckets = []float64{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += value
+	h.count++
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			h.bucketCounts[i]++
+		}
+	}
+}
+
+func (h *Histogram) snapshot() (bucketCounts []uint64, sum float64, count uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64{}, h.bucketCounts...), h.sum, h.count
+}
+
+// metric is anything that can render itself in Prometheus text exposition
+// format under a given metric name.
+type metric interface {
+	writeTo(w io.Writer, name string, help string)
+}
+
+func (c *Counter) writeTo(w io.Writer, name string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatFloat(c.snapshot()))
+}
+
+func (c *CounterVec) writeTo(w io.Writer, name string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	counts := c.snapshot()
+	labels := make([]string, 0, len(counts))
+	for label := range counts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", name, c.labelName, label, formatFloat(counts[label]))
+	}
+}
+
+func (g *Gauge) writeTo(w io.Writer, name string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(g.snapshot()))
+}
+
+func (h *Histogram) writeTo(w io.Writer, name string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	bucketCounts, sum, count := h.snapshot()
+	for i, bound := range h.upperBounds {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, formatFloat(bound), bucketCounts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+type registeredMetric struct {
+	name string
+	help string
+	m    metric
+}
+
+// Registry collects metrics and renders them as one Prometheus exposition
+// document. CrawlEndpoint and friends register against the package-level
+// Default registry; tests can construct their own to stay isolated.
+type Registry struct {
+	mu      sync.Mutex
+	entries []registeredMetric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(name string, help string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, registeredMetric{name: name, help: help, m: m})
+}
+
+func (r *Registry) RegisterCounter(name string, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, c)
+	return c
+}
+
+func (r *Registry) RegisterCounterVec(name string, help string, labelName string) *CounterVec {
+	c := NewCounterVec(labelName)
+	r.register(name, help, c)
+	return c
+}
+
+func (r *Registry) RegisterGauge(name string, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, g)
+	return g
+}
+
+func (r *Registry) RegisterHistogram(name string, help string, upperBounds []float64) *Histogram {
+	h := NewHistogram(upperBounds)
+	r.register(name, help, h)
+	return h
+}
+
+// Render renders every registered metric plus a small set of default Go
+// process collectors (goroutine count, memory stats) in Prometheus text
+// exposition format.
+func (r *Registry) Render(w io.Writer) {
+	r.mu.Lock()
+	entries := append([]registeredMetric{}, r.entries...)
+	r.mu.Unlock()
+
+	for _, entry := range entries {
+		entry.m.writeTo(w, entry.name, entry.help)
+	}
+
+	writeGoCollectors(w)
+}
+
+func writeGoCollectors(w io.Writer) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	fmt.Fprintf(w, "# HELP go_goroutines Number of goroutines that currently exist.\n# TYPE go_goroutines gauge\ngo_goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "# HELP go_memstats_alloc_bytes Number of bytes allocated and still in use.\n# TYPE go_memstats_alloc_bytes gauge\ngo_memstats_alloc_bytes %d\n", memStats.Alloc)
+	fmt.Fprintf(w, "# HELP go_memstats_sys_bytes Number of bytes obtained from the OS.\n# TYPE go_memstats_sys_bytes gauge\ngo_memstats_sys_bytes %d\n", memStats.Sys)
+	fmt.Fprintf(w, "# HELP go_info Build information about the running binary.\n# TYPE go_info gauge\ngo_info{version=%q} 1\n", runtime.Version())
+}
+
+// Default is the registry crawl4ai-proxy's metrics are registered against.
+var Default = NewRegistry()
+
+// Render is a convenience for writing Default's exposition to a
+// strings.Builder-like sink without importing bytes at call sites.
+func Render(w io.Writer) {
+	Default.Render(w)
+}
+
+// Handler serves Default's exposition in the format Prometheus expects at
+// /metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Default.Render(response)
+	})
+}
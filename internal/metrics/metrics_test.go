@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCounterVecRendersLabeledLines(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.RegisterCounterVec("requests_total", "help text", "status")
+	counter.Inc("200")
+	counter.Inc("200")
+	counter.Inc("500")
+
+	var buf strings.Builder
+	registry.Render(&buf)
+	output := buf.String()
+
+	if !strings.Contains(output, `requests_total{status="200"} 2`) {
+		t.Fatalf("expected status=200 count of 2, got:\n%s", output)
+	}
+	if !strings.Contains(output, `requests_total{status="500"} 1`) {
+		t.Fatalf("expected status=500 count of 1, got:\n%s", output)
+	}
+}
+
+func TestHistogramRendersCumulativeBuckets(t *testing.T) {
+	registry := NewRegistry()
+	histogram := registry.RegisterHistogram("duration_seconds", "help text", []float64{1, 5})
+	histogram.Observe(0.5)
+	histogram.Observe(3)
+
+	var buf strings.Builder
+	registry.Render(&buf)
+	output := buf.String()
+
+	if !strings.Contains(output, `duration_seconds_bucket{le="1"} 1`) {
+		t.Fatalf("expected le=1 bucket to contain 1 observation, got:\n%s", output)
+	}
+	if !strings.Contains(output, `duration_seconds_bucket{le="5"} 2`) {
+		t.Fatalf("expected le=5 bucket to be cumulative with 2 observations, got:\n%s", output)
+	}
+	if !strings.Contains(output, "duration_seconds_count 2") {
+		t.Fatalf("expected total count of 2, got:\n%s", output)
+	}
+}
@@ -2,22 +2,44 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"relic664/crawl4ai-proxy/internal/metrics"
 )
 
 var (
-	LISTEN_IP         string = ""
-	LISTEN_PORT       int    = 8000
-	CRAWL4AI_ENDPOINT        = "http://crawl4ai:11235/md"
+	LISTEN_IP         string        = ""
+	LISTEN_PORT       int           = 8000
+	CRAWL4AI_ENDPOINT               = "http://crawl4ai:11235/md"
+	CRAWL_CONCURRENCY int           = 4
+	CRAWL_TIMEOUT     time.Duration = 30 * time.Second
 )
 
+// crawlHTTPClient is dedicated to upstream crawl4ai calls so dial/TLS/header
+// timeouts can't be starved by other http.DefaultClient users. The overall
+// per-request deadline is carried by the request's context instead of the
+// client's Timeout field, since that deadline varies per call.
+var crawlHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
 func ReadEnvironment() {
 	portStr := os.Getenv("LISTEN_PORT")
 	port, err := strconv.Atoi(portStr)
@@ -34,12 +56,69 @@ func ReadEnvironment() {
 	if endpoint != "" {
 		CRAWL4AI_ENDPOINT = endpoint
 	}
+
+	concurrencyStr := os.Getenv("CRAWL_CONCURRENCY")
+	concurrency, err := strconv.Atoi(concurrencyStr)
+	if err == nil && concurrency > 0 {
+		CRAWL_CONCURRENCY = concurrency
+	}
+
+	timeoutStr := os.Getenv("CRAWL_TIMEOUT")
+	if timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err == nil && timeout > 0 {
+			CRAWL_TIMEOUT = timeout
+		}
+	}
+
+	maxBytesStr := os.Getenv("MAX_REQUEST_BYTES")
+	maxBytes, err := strconv.ParseInt(maxBytesStr, 10, 64)
+	if err == nil && maxBytes > 0 {
+		MAX_REQUEST_BYTES = maxBytes
+	}
+
+	ENABLE_GZIP = os.Getenv("ENABLE_GZIP") == "1" || os.Getenv("ENABLE_GZIP") == "true"
+
+	API_KEYS = os.Getenv("API_KEYS")
 }
 
 // For the openwebui-facing endpoint
 type Request struct {
-	Urls []string `json:"urls"`
-	Url  string   `json:"url,omitempty"`
+	Urls           []string `json:"urls"`
+	Url            string   `json:"url,omitempty"`
+	TimeoutSeconds float64  `json:"timeout_seconds,omitempty"`
+
+	// BrowserConfig and CrawlerRunConfig are passed through to crawl4ai
+	// verbatim and deep-merged on top of our defaults, so callers can use
+	// any crawl4ai option without us having to track each one explicitly.
+	BrowserConfig    map[string]any `json:"browser_config,omitempty"`
+	CrawlerRunConfig map[string]any `json:"crawler_run_config,omitempty"`
+
+	// Shortcuts for the handful of crawlerRunConfig knobs callers reach for
+	// most often; folded into CrawlerRunConfig before the deep merge.
+	Screenshot bool     `json:"screenshot,omitempty"`
+	WaitFor    string   `json:"wait_for,omitempty"`
+	JsCode     []string `json:"js_code,omitempty"`
+	SessionId  string   `json:"session_id,omitempty"`
+	CacheMode  string   `json:"cache_mode,omitempty"`
+}
+
+// crawlDeadline picks the overall timeout for a single crawl request, in
+// order of precedence: the X-Crawl-Timeout header, the request body's
+// timeout_seconds field, then the CRAWL_TIMEOUT default.
+func crawlDeadline(request *http.Request, requestData Request) time.Duration {
+	if header := request.Header.Get("X-Crawl-Timeout"); header != "" {
+		seconds, err := strconv.ParseFloat(header, 64)
+		if err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if requestData.TimeoutSeconds > 0 {
+		return time.Duration(requestData.TimeoutSeconds * float64(time.Second))
+	}
+
+	return CRAWL_TIMEOUT
 }
 
 type SuccessResponseItem struct {
@@ -179,16 +258,29 @@ func normalizeRequestUrls(requestData Request) []string {
 	return ret
 }
 
-func crawlRequestPayloadCandidates(urls []string) [][]byte {
+// crawlUpstreamPayload is the body we actually send to crawl4ai, as
+// opposed to Request, which is the shape openwebui-style clients send us.
+// browserConfig/crawlerRunConfig use crawl4ai's own camelCase naming.
+type crawlUpstreamPayload struct {
+	Url              string         `json:"url,omitempty"`
+	Urls             []string       `json:"urls,omitempty"`
+	BrowserConfig    map[string]any `json:"browserConfig"`
+	CrawlerRunConfig map[string]any `json:"crawlerRunConfig"`
+}
+
+func crawlRequestPayloadCandidates(urls []string, overrides Request) [][]byte {
+	browserConfig := effectiveBrowserConfig(overrides)
+	crawlerRunConfig := effectiveCrawlerRunConfig(overrides)
+
 	if len(urls) == 1 {
 		return [][]byte{
-			jsonEncodeInfallible(Request{Url: urls[0]}),
-			jsonEncodeInfallible(Request{Urls: urls}),
+			jsonEncodeInfallible(crawlUpstreamPayload{Url: urls[0], BrowserConfig: browserConfig, CrawlerRunConfig: crawlerRunConfig}),
+			jsonEncodeInfallible(crawlUpstreamPayload{Urls: urls, BrowserConfig: browserConfig, CrawlerRunConfig: crawlerRunConfig}),
 		}
 	}
 
 	return [][]byte{
-		jsonEncodeInfallible(Request{Urls: urls}),
+		jsonEncodeInfallible(crawlUpstreamPayload{Urls: urls, BrowserConfig: browserConfig, CrawlerRunConfig: crawlerRunConfig}),
 	}
 }
 
@@ -208,14 +300,22 @@ type CrawlAPICallResult struct {
 	Err         error
 }
 
-func callCrawlAPI(payload []byte) CrawlAPICallResult {
-	req, err := http.NewRequest("POST", CRAWL4AI_ENDPOINT, bytes.NewReader(payload))
+func callCrawlAPI(ctx context.Context, payload []byte) CrawlAPICallResult {
+	callStart := time.Now()
+	result := doCallCrawlAPI(ctx, payload)
+	crawlUpstreamDuration.Observe(time.Since(callStart).Seconds())
+	crawlUpstreamCallsTotal.Inc(upstreamCallOutcome(result))
+	return result
+}
+
+func doCallCrawlAPI(ctx context.Context, payload []byte) CrawlAPICallResult {
+	req, err := http.NewRequestWithContext(ctx, "POST", CRAWL4AI_ENDPOINT, bytes.NewReader(payload))
 	if err != nil {
 		return CrawlAPICallResult{Err: err}
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	crawlResponse, err := http.DefaultClient.Do(req)
+	crawlResponse, err := crawlHTTPClient.Do(req)
 	if err != nil {
 		return CrawlAPICallResult{Err: err}
 	}
@@ -248,33 +348,42 @@ func callCrawlAPI(payload []byte) CrawlAPICallResult {
 	}
 }
 
-func callCrawlAPIWithFallback(urls []string) CrawlAPICallResult {
+func callCrawlAPIWithFallback(ctx context.Context, urls []string, overrides Request) CrawlAPICallResult {
 	var lastResult CrawlAPICallResult
-	for _, payload := range crawlRequestPayloadCandidates(urls) {
-		result := callCrawlAPI(payload)
+	for _, payload := range crawlRequestPayloadCandidates(urls, overrides) {
+		result := callCrawlAPI(ctx, payload)
 		if result.Err == nil && result.StatusCode == 200 {
 			return result
 		}
 		lastResult = result
+		if ctx.Err() != nil {
+			break
+		}
 	}
 	return lastResult
 }
 
+// writeJSONResponse writes a JSON body with the given status code and
+// records the outcome in crawl_requests_total.
+func writeJSONResponse(response http.ResponseWriter, statusCode int, body []byte) {
+	crawlRequestsTotal.Inc(strconv.Itoa(statusCode))
+	response.WriteHeader(statusCode)
+	response.Write(body)
+}
+
 func CrawlEndpoint(response http.ResponseWriter, request *http.Request) {
 	response.Header().Set("Content-Type", "application/json")
 
 	if request.Method != "POST" {
-		response.WriteHeader(405)
 		resp := ErrorResponse{ErrorName: "method not allowed"}
-		response.Write(jsonEncodeInfallible(resp))
+		writeJSONResponse(response, 405, jsonEncodeInfallible(resp))
 		log.Printf("405 method not allowed :: %s\n", request.RemoteAddr)
 		return
 	}
 
 	if !strings.HasPrefix(request.Header.Get("Content-Type"), "application/json") {
-		response.WriteHeader(400)
 		resp := ErrorResponse{ErrorName: "content type must be application/json"}
-		response.Write(jsonEncodeInfallible(resp))
+		writeJSONResponse(response, 400, jsonEncodeInfallible(resp))
 		log.Printf("400 invalid content type :: %s\n", request.RemoteAddr)
 		return
 	}
@@ -282,29 +391,58 @@ func CrawlEndpoint(response http.ResponseWriter, request *http.Request) {
 	var requestData Request
 	err := json.NewDecoder(request.Body).Decode(&requestData)
 	if err != nil {
-		response.WriteHeader(400)
 		resp := errorResponseFromError("invalid json", err)
-		response.Write(jsonEncodeInfallible(resp))
+		writeJSONResponse(response, 400, jsonEncodeInfallible(resp))
 		log.Printf("400 invalid json :: %s\n", request.RemoteAddr)
 		return
 	}
 
 	requestUrls := normalizeRequestUrls(requestData)
 	if len(requestUrls) == 0 {
-		response.WriteHeader(400)
 		resp := ErrorResponse{ErrorName: "invalid json", Detail: "request must include `url` or `urls`"}
-		response.Write(jsonEncodeInfallible(resp))
+		writeJSONResponse(response, 400, jsonEncodeInfallible(resp))
 		log.Printf("400 invalid json :: %s\n", request.RemoteAddr)
 		return
 	}
 
 	log.Printf("Request to crawl %s from %s\n", requestUrls, request.RemoteAddr)
 
-	crawlAPICallResult := callCrawlAPIWithFallback(requestUrls)
+	ctx, cancel := context.WithTimeout(request.Context(), crawlDeadline(request, requestData))
+	defer cancel()
+
+	if wantsStreamingResponse(request) {
+		streamCrawlResults(ctx, response, request, requestUrls, requestData)
+		log.Printf("200 (streamed) :: %s\n", request.RemoteAddr)
+		return
+	}
+
+	browserConfig := effectiveBrowserConfig(requestData)
+	crawlerRunConfig := effectiveCrawlerRunConfig(requestData)
+	bypassCache := request.URL.Query().Get("no_cache") == "1"
+
+	if cacheBackend != nil && !bypassCache {
+		if cachedItems, allHit := lookupCachedItems(requestUrls, browserConfig, crawlerRunConfig); allHit {
+			response.Header().Set("X-Cache", "HIT")
+			responseBody := jsonEncodeInfallible(SuccessResponse(cachedItems))
+			crawlResultItemsTotal.Add(float64(len(cachedItems)))
+			crawlResponseBytes.Observe(float64(len(responseBody)))
+			writeJSONResponse(response, 200, responseBody)
+			log.Printf("200 (cache hit) :: %s\n", request.RemoteAddr)
+			return
+		}
+	}
+
+	crawlAPICallResult := callCrawlAPIWithFallback(ctx, requestUrls, requestData)
 	if crawlAPICallResult.Err != nil {
-		response.WriteHeader(502)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			resp := ErrorResponse{ErrorName: "deadline exceeded"}
+			writeJSONResponse(response, 504, jsonEncodeInfallible(resp))
+			log.Printf("504 deadline exceeded :: %s\n", request.RemoteAddr)
+			return
+		}
+
 		resp := ErrorResponse{ErrorName: "bad gateway", Detail: crawlAPICallResult.Err.Error()}
-		response.Write(jsonEncodeInfallible(resp))
+		writeJSONResponse(response, 502, jsonEncodeInfallible(resp))
 		log.Printf("502 bad gateway - crawl api call failed: %v :: %s\n", crawlAPICallResult.Err, request.RemoteAddr)
 		return
 	}
@@ -315,9 +453,8 @@ func CrawlEndpoint(response http.ResponseWriter, request *http.Request) {
 			errorDetail += ": " + crawlAPICallResult.BodyPreview
 		}
 
-		response.WriteHeader(502)
 		resp := ErrorResponse{ErrorName: "bad gateway", Detail: errorDetail}
-		response.Write(jsonEncodeInfallible(resp))
+		writeJSONResponse(response, 502, jsonEncodeInfallible(resp))
 		log.Printf(
 			"502 bad gateway - crawl api status=%d body=%q :: %s\n",
 			crawlAPICallResult.StatusCode,
@@ -331,9 +468,8 @@ func CrawlEndpoint(response http.ResponseWriter, request *http.Request) {
 
 	crawlResults := decodeResults(crawlData)
 	if crawlResults == nil {
-		response.WriteHeader(502)
 		resp := ErrorResponse{ErrorName: "bad gateway", Detail: "invalid json structure received from crawl api"}
-		response.Write(jsonEncodeInfallible(resp))
+		writeJSONResponse(response, 502, jsonEncodeInfallible(resp))
 		log.Printf("502 bad gateway - invalid json structure from crawl api :: %s\n", request.RemoteAddr)
 		return
 	}
@@ -353,16 +489,42 @@ func CrawlEndpoint(response http.ResponseWriter, request *http.Request) {
 		})
 	}
 
-	response.WriteHeader(200)
-	response.Write(jsonEncodeInfallible(ret))
+	if cacheBackend != nil && !bypassCache {
+		storeCachedItems(ret, requestUrls, browserConfig, crawlerRunConfig)
+		response.Header().Set("X-Cache", "MISS")
+	} else {
+		response.Header().Set("X-Cache", "BYPASS")
+	}
+
+	crawlResultItemsTotal.Add(float64(len(ret)))
+	responseBody := jsonEncodeInfallible(ret)
+	crawlResponseBytes.Observe(float64(len(responseBody)))
+
+	writeJSONResponse(response, 200, responseBody)
 	log.Printf("200 :: %s\n", request.RemoteAddr)
 }
 
 func main() {
 	ReadEnvironment()
-
-	http.HandleFunc("/crawl", CrawlEndpoint)
-	http.HandleFunc("/md", CrawlEndpoint)
+	readMetricsEnvironment()
+	readCacheEnvironment()
+
+	handler := buildHandler()
+	http.Handle("/crawl", handler)
+	http.Handle("/md", handler)
+
+	if METRICS_LISTEN != "" {
+		go func() {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", metrics.Handler())
+			log.Printf("Metrics listening on %s\n", METRICS_LISTEN)
+			if err := http.ListenAndServe(METRICS_LISTEN, metricsMux); err != nil {
+				log.Println(err)
+			}
+		}()
+	} else {
+		http.Handle("/metrics", metrics.Handler())
+	}
 
 	listenAddress := fmt.Sprintf("%s:%d", LISTEN_IP, LISTEN_PORT)
 	log.Printf("Listening on %s\n", listenAddress)
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+
+	"relic664/crawl4ai-proxy/internal/metrics"
+)
+
+var (
+	METRICS_LISTEN string = ""
+
+	crawlRequestsTotal      = metrics.Default.RegisterCounterVec("crawl_requests_total", "Total number of crawl requests by response status.", "status")
+	crawlUpstreamCallsTotal = metrics.Default.RegisterCounterVec("crawl_upstream_calls_total", "Total number of upstream crawl4ai calls by outcome.", "outcome")
+	crawlUpstreamDuration   = metrics.Default.RegisterHistogram("crawl_upstream_duration_seconds", "Duration of upstream crawl4ai calls in seconds.", metrics.DefaultDurationBuckets)
+	crawlResultItemsTotal   = metrics.Default.RegisterCounter("crawl_result_items_total", "Total number of result items returned across all crawl requests.")
+	crawlResponseBytes      = metrics.Default.RegisterHistogram("crawl_response_bytes", "Size in bytes of crawl response bodies written to clients.", metrics.DefaultByteBuckets)
+
+	buildInfo = metrics.Default.RegisterGauge("crawl4ai_proxy_build_info", "Always 1; present so the binary shows up as scraped.")
+
+	crawlCacheHitsTotal   = metrics.Default.RegisterCounter("crawl_cache_hits_total", "Total number of crawl results served from cache.")
+	crawlCacheMissesTotal = metrics.Default.RegisterCounter("crawl_cache_misses_total", "Total number of crawl results that required an upstream call.")
+)
+
+func init() {
+	buildInfo.Set(1)
+}
+
+// upstreamCallOutcome classifies a CrawlAPICallResult for the
+// crawl_upstream_calls_total counter.
+func upstreamCallOutcome(result CrawlAPICallResult) string {
+	if result.Err != nil {
+		if result.StatusCode == 0 {
+			return "network_error"
+		}
+		return "invalid_json"
+	}
+	if result.StatusCode != 200 {
+		return "http_error"
+	}
+	return "success"
+}
+
+func readMetricsEnvironment() {
+	METRICS_LISTEN = os.Getenv("METRICS_LISTEN")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var (
+	MAX_REQUEST_BYTES int64  = 1 << 20 // 1 MiB
+	ENABLE_GZIP       bool   = false
+	API_KEYS          string = ""
+)
+
+// buildHandler wraps CrawlEndpoint in the middleware chain, innermost first:
+// body-size limiting always applies, gzip and API-key auth are opt-in via
+// env vars so operators can layer them on incrementally.
+func buildHandler() http.Handler {
+	var handler http.Handler = http.HandlerFunc(CrawlEndpoint)
+
+	handler = maxBytesMiddleware(MAX_REQUEST_BYTES, handler)
+
+	if ENABLE_GZIP {
+		handler = gzipMiddleware(handler)
+	}
+
+	apiKeys := splitAPIKeys(API_KEYS)
+	if len(apiKeys) > 0 {
+		handler = apiKeyMiddleware(apiKeys, handler)
+	}
+
+	return handler
+}
+
+func splitAPIKeys(raw string) []string {
+	keys := []string{}
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// maxBytesMiddleware rejects request bodies larger than maxBytes with a 413
+// before the handler ever reaches json.NewDecoder, which otherwise reads the
+// body unbounded.
+func maxBytesMiddleware(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		request.Body = http.MaxBytesReader(response, request.Body, maxBytes)
+
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			response.Header().Set("Content-Type", "application/json")
+			resp := ErrorResponse{ErrorName: "request body too large", Detail: err.Error()}
+			writeJSONResponse(response, 413, jsonEncodeInfallible(resp))
+			log.Printf("413 request body too large :: %s\n", request.RemoteAddr)
+			return
+		}
+
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(response, request)
+	})
+}
+
+// gzipResponseWriter transparently gzip-encodes everything written to it,
+// mirroring Caddy's gzip middleware: drop Content-Length (the compressed
+// size isn't known up front), mark Content-Encoding, and pass Flush through
+// so streaming responses still flush incrementally.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer      *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	w.wroteHeader = true
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *gzipResponseWriter) Write(content []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.writer.Write(content)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	w.writer.Flush()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func acceptsGzip(request *http.Request) bool {
+	for _, encoding := range strings.Split(request.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(encoding) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(request) {
+			next.ServeHTTP(response, request)
+			return
+		}
+
+		gzipWriter := gzip.NewWriter(response)
+		defer gzipWriter.Close()
+
+		next.ServeHTTP(&gzipResponseWriter{ResponseWriter: response, writer: gzipWriter}, request)
+	})
+}
+
+// apiKeyMiddleware accepts either an `Authorization: Bearer <key>` header or
+// an `X-API-Key` header, checked against the operator-configured key set.
+func apiKeyMiddleware(validKeys []string, next http.Handler) http.Handler {
+	keySet := map[string]bool{}
+	for _, key := range validKeys {
+		keySet[key] = true
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		key := apiKeyFromRequest(request)
+		if key == "" || !keySet[key] {
+			response.Header().Set("Content-Type", "application/json")
+			resp := ErrorResponse{ErrorName: "unauthorized"}
+			writeJSONResponse(response, 401, jsonEncodeInfallible(resp))
+			log.Printf("401 unauthorized :: %s\n", request.RemoteAddr)
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
+
+func apiKeyFromRequest(request *http.Request) string {
+	if auth := request.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return request.Header.Get("X-API-Key")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"relic664/crawl4ai-proxy/internal/metrics"
+)
+
+func TestMaxBytesMiddlewareRejectsOversizedBody(t *testing.T) {
+	handler := maxBytesMiddleware(10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("handler should not be reached for an oversized body")
+	}))
+
+	request := httptest.NewRequest("POST", "/crawl", strings.NewReader("this body is far too long"))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != 413 {
+		t.Fatalf("expected 413, got %d", recorder.Code)
+	}
+
+	var rendered bytes.Buffer
+	metrics.Default.Render(&rendered)
+	if !strings.Contains(rendered.String(), `crawl_requests_total{status="413"}`) {
+		t.Fatalf("expected a 413 response to be recorded in crawl_requests_total, got:\n%s", rendered.String())
+	}
+}
+
+func TestMaxBytesMiddlewarePassesSmallBody(t *testing.T) {
+	var seenBody string
+	handler := maxBytesMiddleware(1<<20, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make([]byte, 5)
+		n, _ := r.Body.Read(body)
+		seenBody = string(body[:n])
+	}))
+
+	request := httptest.NewRequest("POST", "/crawl", strings.NewReader("hello"))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if seenBody != "hello" {
+		t.Fatalf("expected handler to see the original body, got %q", seenBody)
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	handler := apiKeyMiddleware([]string{"secret"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	request := httptest.NewRequest("POST", "/crawl", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 401 {
+		t.Fatalf("expected 401 without a key, got %d", recorder.Code)
+	}
+
+	var rendered bytes.Buffer
+	metrics.Default.Render(&rendered)
+	if !strings.Contains(rendered.String(), `crawl_requests_total{status="401"}`) {
+		t.Fatalf("expected a 401 response to be recorded in crawl_requests_total, got:\n%s", rendered.String())
+	}
+
+	request = httptest.NewRequest("POST", "/crawl", nil)
+	request.Header.Set("X-API-Key", "secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 with X-API-Key, got %d", recorder.Code)
+	}
+
+	request = httptest.NewRequest("POST", "/crawl", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 with Bearer token, got %d", recorder.Code)
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello, world"))
+	}))
+
+	request := httptest.NewRequest("GET", "/crawl", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected Content-Encoding: gzip, got %q", recorder.Header().Get("Content-Encoding"))
+	}
+	if recorder.Body.String() == "hello, world" {
+		t.Fatalf("expected compressed body, got plain text")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+// defaultBrowserConfig and defaultCrawlerRunConfig are the fixed options
+// the proxy has always sent to crawl4ai. Per-request overrides are
+// deep-merged on top so callers can reach any crawl4ai option without a
+// code change each time crawl4ai grows one.
+func defaultBrowserConfig() map[string]any {
+	return map[string]any{
+		"text_mode": true,
+	}
+}
+
+func defaultCrawlerRunConfig() map[string]any {
+	return map[string]any{
+		"remove_overlay_elements": true,
+		"magic":                   true,
+		"exclude_all_images":      true,
+	}
+}
+
+// deepMergeMaps merges override on top of base: override wins on key
+// conflicts, nested objects are merged recursively, and keys present in
+// only one side are preserved verbatim. Neither input is mutated.
+func deepMergeMaps(base map[string]any, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, overrideValue := range override {
+		baseValue, baseHasKey := merged[key]
+		baseMap, baseIsMap := baseValue.(map[string]any)
+		overrideMap, overrideIsMap := overrideValue.(map[string]any)
+
+		if baseHasKey && baseIsMap && overrideIsMap {
+			merged[key] = deepMergeMaps(baseMap, overrideMap)
+			continue
+		}
+
+		merged[key] = overrideValue
+	}
+
+	return merged
+}
+
+func effectiveBrowserConfig(overrides Request) map[string]any {
+	return deepMergeMaps(defaultBrowserConfig(), overrides.BrowserConfig)
+}
+
+// effectiveCrawlerRunConfig layers, from lowest to highest precedence: the
+// fixed defaults, the convenience shortcut fields, then the explicit
+// crawler_run_config object.
+func effectiveCrawlerRunConfig(overrides Request) map[string]any {
+	shortcuts := map[string]any{}
+	if overrides.Screenshot {
+		shortcuts["screenshot"] = true
+	}
+	if overrides.WaitFor != "" {
+		shortcuts["wait_for"] = overrides.WaitFor
+	}
+	if len(overrides.JsCode) > 0 {
+		shortcuts["js_code"] = overrides.JsCode
+	}
+	if overrides.SessionId != "" {
+		shortcuts["session_id"] = overrides.SessionId
+	}
+	if overrides.CacheMode != "" {
+		shortcuts["cache_mode"] = overrides.CacheMode
+	}
+
+	merged := deepMergeMaps(defaultCrawlerRunConfig(), shortcuts)
+	return deepMergeMaps(merged, overrides.CrawlerRunConfig)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"relic664/crawl4ai-proxy/internal/metrics"
+)
+
+func TestWantsStreamingResponse(t *testing.T) {
+	request, err := http.NewRequest("POST", "/crawl", nil)
+	if err != nil {
+		panic(err)
+	}
+	if wantsStreamingResponse(request) {
+		t.Fatalf("expected plain request to not opt into streaming")
+	}
+
+	request, err = http.NewRequest("POST", "/crawl?stream=1", nil)
+	if err != nil {
+		panic(err)
+	}
+	if !wantsStreamingResponse(request) {
+		t.Fatalf("expected ?stream=1 to opt into streaming")
+	}
+
+	request, err = http.NewRequest("POST", "/crawl", nil)
+	if err != nil {
+		panic(err)
+	}
+	request.Header.Set("Accept", "application/x-ndjson")
+	if !wantsStreamingResponse(request) {
+		t.Fatalf("expected Accept: application/x-ndjson to opt into streaming")
+	}
+}
+
+func TestCrawlOneAsStreamLineReportsNetworkErrors(t *testing.T) {
+	previousEndpoint := CRAWL4AI_ENDPOINT
+	CRAWL4AI_ENDPOINT = "http://127.0.0.1:0/md"
+	defer func() { CRAWL4AI_ENDPOINT = previousEndpoint }()
+
+	line := crawlOneAsStreamLine(context.Background(), "https://example.com", Request{}, map[string]any{}, map[string]any{}, true)
+
+	var decoded StreamErrorItem
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatalf("expected a decodable error line, got %q: %v", line, err)
+	}
+	if decoded.Url != "https://example.com" {
+		t.Fatalf("expected error line to carry the url, got %#v", decoded)
+	}
+	if decoded.ErrorName == "" {
+		t.Fatalf("expected a non-empty error message")
+	}
+}
+
+func TestStreamCrawlResultsRecordsMetrics(t *testing.T) {
+	previousEndpoint := CRAWL4AI_ENDPOINT
+	CRAWL4AI_ENDPOINT = "http://127.0.0.1:0/md"
+	defer func() { CRAWL4AI_ENDPOINT = previousEndpoint }()
+
+	request := httptest.NewRequest("POST", "/crawl?stream=1", nil)
+	recorder := httptest.NewRecorder()
+
+	streamCrawlResults(context.Background(), recorder, request, []string{"https://example.com"}, Request{})
+
+	var rendered bytes.Buffer
+	metrics.Default.Render(&rendered)
+	output := rendered.String()
+
+	if !strings.Contains(output, `crawl_requests_total{status="200"}`) {
+		t.Fatalf("expected a streamed response to be recorded in crawl_requests_total, got:\n%s", output)
+	}
+}
+
+func TestStreamCrawlResultsSetsXCacheHeader(t *testing.T) {
+	previousEndpoint := CRAWL4AI_ENDPOINT
+	CRAWL4AI_ENDPOINT = "http://127.0.0.1:0/md"
+	defer func() { CRAWL4AI_ENDPOINT = previousEndpoint }()
+
+	previousBackend := cacheBackend
+	defer func() { cacheBackend = previousBackend }()
+
+	cacheBackend = nil
+	recorder := httptest.NewRecorder()
+	streamCrawlResults(context.Background(), recorder, httptest.NewRequest("POST", "/crawl?stream=1", nil), []string{"https://example.com"}, Request{})
+	if got := recorder.Header().Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("expected X-Cache: BYPASS with caching disabled, got %q", got)
+	}
+
+	cacheBackend = newMemoryCache(10)
+	recorder = httptest.NewRecorder()
+	streamCrawlResults(context.Background(), recorder, httptest.NewRequest("POST", "/crawl?stream=1", nil), []string{"https://example.com"}, Request{})
+	if got := recorder.Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("expected X-Cache: MISS with caching enabled, got %q", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	streamCrawlResults(context.Background(), recorder, httptest.NewRequest("POST", "/crawl?stream=1&no_cache=1", nil), []string{"https://example.com"}, Request{})
+	if got := recorder.Header().Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("expected X-Cache: BYPASS with no_cache=1, got %q", got)
+	}
+}